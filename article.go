@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	articleFetchTimeout = 20 * time.Second
+	maxArticleBodyBytes = 2 << 20 // 2MB
+	maxRedirects        = 5
+)
+
+var articleHTTPClient = &http.Client{
+	Timeout: articleFetchTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	},
+}
+
+// fetchURL downloads rawURL with a browser-like User-Agent and returns its
+// Content-Type and body, capped at maxArticleBodyBytes.
+func fetchURL(ctx context.Context, rawURL string) (contentType string, body []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; ai-pplx-slack-bot/1.0; +https://slack.com)")
+
+	resp, err := articleHTTPClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "", nil, fmt.Errorf("fetching %s: status %d", rawURL, resp.StatusCode)
+	}
+
+	body, err = io.ReadAll(io.LimitReader(resp.Body, maxArticleBodyBytes))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return resp.Header.Get("Content-Type"), body, nil
+}
+
+// looksLikeFeed reports whether contentType or rawURL indicates an RSS/Atom
+// feed rather than a regular HTML page.
+func looksLikeFeed(contentType, rawURL string) bool {
+	ct := strings.ToLower(contentType)
+	if strings.Contains(ct, "rss") || strings.Contains(ct, "atom") || strings.Contains(ct, "xml") {
+		return true
+	}
+	lowerURL := strings.ToLower(rawURL)
+	for _, suffix := range []string{".rss", ".xml", "/feed", "/feed/", "/rss"} {
+		if strings.HasSuffix(lowerURL, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	paragraphRe  = regexp.MustCompile(`(?is)<p[^>]*>(.*?)</p>`)
+	tagRe        = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespaceRe = regexp.MustCompile(`\s+`)
+)
+
+// extractArticleText runs a small arc90-readability-style pass over an HTML
+// document: strip boilerplate tags, then keep the <p> blocks that look like
+// prose rather than nav/footer cruft.
+func extractArticleText(doc string) string {
+	stripped := stripBoilerplateTags(doc)
+
+	var paragraphs []string
+	for _, match := range paragraphRe.FindAllStringSubmatch(stripped, -1) {
+		text := cleanText(match[1])
+		if len(text) > 40 {
+			paragraphs = append(paragraphs, text)
+		}
+	}
+
+	if len(paragraphs) == 0 {
+		// No <p> blocks dense enough to count as prose; fall back to the
+		// whole stripped document so we still return something.
+		return cleanText(stripped)
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// stripBoilerplateTags removes script/style/nav/footer/header/aside elements
+// and their contents, one tag name at a time since Go's regexp can't
+// backreference a captured tag name.
+func stripBoilerplateTags(doc string) string {
+	for _, tag := range []string{"script", "style", "noscript", "nav", "footer", "header", "aside"} {
+		re := regexp.MustCompile(`(?is)<` + tag + `[^>]*>.*?</` + tag + `>`)
+		doc = re.ReplaceAllString(doc, "")
+	}
+	return doc
+}
+
+// cleanText strips remaining tags, unescapes HTML entities, and collapses
+// whitespace.
+func cleanText(fragment string) string {
+	text := tagRe.ReplaceAllString(fragment, " ")
+	text = html.UnescapeString(text)
+	text = whitespaceRe.ReplaceAllString(text, " ")
+	return strings.TrimSpace(text)
+}
+
+// getCachedSummary returns a previously-computed summary for url, if any.
+func getCachedSummary(url string) (string, bool, error) {
+	var summary string
+	err := db.QueryRow("SELECT summary FROM summaries WHERE url = ?", url).Scan(&summary)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return summary, true, nil
+}
+
+// saveSummary caches a summary for url, replacing any prior entry.
+func saveSummary(url, summary string) error {
+	_, err := db.Exec(
+		"INSERT INTO summaries (url, summary, created_at) VALUES (?, ?, strftime('%s','now')) "+
+			"ON CONFLICT(url) DO UPDATE SET summary = excluded.summary, created_at = excluded.created_at",
+		url, summary,
+	)
+	return err
+}
+
+func summarizeArticle(parentCtx context.Context, url string) (string, error) {
+	if cached, ok, err := getCachedSummary(url); err != nil {
+		return "", err
+	} else if ok {
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, articleFetchTimeout)
+	defer cancel()
+
+	var articleText string
+
+	contentType, body, fetchErr := fetchURL(ctx, url)
+	switch {
+	case fetchErr == nil && looksLikeFeed(contentType, url):
+		text, err := summarizeViaFeed(ctx, url)
+		if err != nil {
+			return "", err
+		}
+		articleText = text
+	case fetchErr == nil:
+		articleText = extractArticleText(string(body))
+		if articleText == "" {
+			return "", fmt.Errorf("could not extract article text from %s", url)
+		}
+	default:
+		return "", fmt.Errorf("fetching article: %w", fetchErr)
+	}
+
+	summary, err := PerplexityAPI(ctx, []Message{{
+		Role: "user",
+		Content: fmt.Sprintf(
+			"Summarize the following article in 5 bullet points and list the key entities mentioned:\n\n%s",
+			articleText,
+		),
+	}})
+	if err != nil {
+		return "", err
+	}
+
+	if err := saveSummary(url, summary); err != nil {
+		return "", err
+	}
+
+	return summary, nil
+}
+
+// summarizeViaFeed preserves the original behavior for URLs that are
+// themselves RSS/Atom feeds rather than articles.
+func summarizeViaFeed(ctx context.Context, url string) (string, error) {
+	fp := gofeed.NewParser()
+	feed, err := fp.ParseURLWithContext(url, ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(feed.Items) == 0 {
+		return "", fmt.Errorf("no items found in the feed")
+	}
+	article := feed.Items[0]
+	return fmt.Sprintf("Title: %s\n\nDescription: %s", article.Title, article.Description), nil
+}
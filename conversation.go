@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+)
+
+// Message is a single turn in a conversation, in Perplexity/OpenAI chat
+// format.
+type Message struct {
+	Role    string
+	Content string
+}
+
+// ConversationStore persists conversation history under keys built by
+// conversationKey: per (team, channel, thread_ts) inside a thread, shared by
+// everyone in that thread, and per (team, channel, user) otherwise, so
+// unrelated channels and users outside threads don't share state.
+type ConversationStore struct {
+	db *sql.DB
+}
+
+// NewConversationStore wraps db and ensures the conversations table exists.
+func NewConversationStore(db *sql.DB) (*ConversationStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS conversations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT NOT NULL,
+		role TEXT NOT NULL,
+		content TEXT NOT NULL,
+		ts INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &ConversationStore{db: db}, nil
+}
+
+// conversationKey scopes history to the thread when the message is part of
+// one, otherwise to the channel+user so unrelated DMs/channels don't mix.
+func conversationKey(team, channel, threadTS, user string) string {
+	if threadTS != "" {
+		return team + ":" + channel + ":" + threadTS
+	}
+	return team + ":" + channel + ":" + user
+}
+
+// Append records one turn of a conversation.
+func (s *ConversationStore) Append(key, role, content string) error {
+	_, err := s.db.Exec(
+		"INSERT INTO conversations (key, role, content, ts) VALUES (?, ?, ?, strftime('%s','now'))",
+		key, role, content,
+	)
+	return err
+}
+
+// History returns the last n turns for key, oldest first, ready to send to
+// PerplexityAPI.
+func (s *ConversationStore) History(key string, n int) ([]Message, error) {
+	rows, err := s.db.Query(
+		"SELECT role, content FROM conversations WHERE key = ? ORDER BY id DESC LIMIT ?",
+		key, n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reversed []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.Role, &m.Content); err != nil {
+			return nil, err
+		}
+		reversed = append(reversed, m)
+	}
+
+	history := make([]Message, len(reversed))
+	for i, m := range reversed {
+		history[len(reversed)-1-i] = m
+	}
+	return history, nil
+}
+
+// Reset deletes all history for key.
+func (s *ConversationStore) Reset(key string) error {
+	_, err := s.db.Exec("DELETE FROM conversations WHERE key = ?", key)
+	return err
+}
+
+// maxHistoryTurns bounds how many prior turns are sent to Perplexity as
+// context.
+const maxHistoryTurns = 20
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/slack-go/slack"
+)
+
+// nowFunc is the clock used for "saved in the last 24h" windows. Tests
+// override it with a fake clock.
+var nowFunc = time.Now
+
+// defaultDigestCron runs once a day at 09:00.
+const defaultDigestCron = "0 9 * * *"
+
+// recentHyperlinks returns URLs saved since since.
+func recentHyperlinks(since time.Time) ([]string, error) {
+	rows, err := db.Query("SELECT url FROM hyperlinks WHERE saved_ts >= ?", since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		links = append(links, url)
+	}
+	return links, nil
+}
+
+// subscribeChannel opts channelID into the daily digest.
+func subscribeChannel(channelID string) error {
+	_, err := db.Exec(
+		"INSERT INTO subscriptions (channel_id, subscribed_at) VALUES (?, ?) ON CONFLICT(channel_id) DO NOTHING",
+		channelID, nowFunc().Unix(),
+	)
+	return err
+}
+
+// unsubscribeChannel opts channelID out of the daily digest.
+func unsubscribeChannel(channelID string) error {
+	_, err := db.Exec("DELETE FROM subscriptions WHERE channel_id = ?", channelID)
+	return err
+}
+
+// subscribedChannels lists all channels currently opted into the digest.
+func subscribedChannels() ([]string, error) {
+	rows, err := db.Query("SELECT channel_id FROM subscriptions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []string
+	for rows.Next() {
+		var channelID string
+		if err := rows.Scan(&channelID); err != nil {
+			return nil, err
+		}
+		channels = append(channels, channelID)
+	}
+	return channels, nil
+}
+
+var (
+	channelMentionRe = regexp.MustCompile(`^<#([A-Z0-9]+)(?:\|[^>]*)?>$`)
+	channelIDRe      = regexp.MustCompile(`^[CGD][A-Z0-9]{8,}$`)
+)
+
+// resolveChannelArg resolves the optional channel argument to `!subscribe`
+// /`!unsubscribe` to a channel ID: a Slack channel mention
+// (<#C0123|name>), a raw channel ID, or a bare "#name"/"name" looked up by
+// name. An empty arg resolves to fallback (the channel the command was
+// typed in).
+func resolveChannelArg(arg, fallback string) (string, error) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return fallback, nil
+	}
+	if m := channelMentionRe.FindStringSubmatch(arg); m != nil {
+		return m[1], nil
+	}
+	if channelIDRe.MatchString(arg) {
+		return arg, nil
+	}
+	return lookupChannelIDByName(strings.TrimPrefix(arg, "#"))
+}
+
+// lookupChannelIDByName finds a channel's ID by its name via the Slack API.
+func lookupChannelIDByName(name string) (string, error) {
+	cursor := ""
+	for {
+		channels, nextCursor, err := slackClient.GetConversations(&slack.GetConversationsParameters{
+			Cursor: cursor,
+			Limit:  200,
+			Types:  []string{"public_channel", "private_channel"},
+		})
+		if err != nil {
+			return "", fmt.Errorf("listing channels: %w", err)
+		}
+		for _, ch := range channels {
+			if ch.Name == name {
+				return ch.ID, nil
+			}
+		}
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+	return "", fmt.Errorf("channel #%s not found", name)
+}
+
+// startDigestScheduler starts a cron job that posts the daily digest to
+// defaultChannelID (if non-empty) and every subscribed channel. cronExpr
+// falls back to defaultDigestCron when empty. ctx is cancelled on shutdown
+// and threaded into each digest run's article fetches/summaries.
+func startDigestScheduler(ctx context.Context, defaultChannelID, cronExpr string) (*cron.Cron, error) {
+	if cronExpr == "" {
+		cronExpr = defaultDigestCron
+	}
+
+	c := cron.New()
+	_, err := c.AddFunc(cronExpr, func() {
+		runDigest(ctx, defaultChannelID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scheduling digest cron %q: %w", cronExpr, err)
+	}
+	c.Start()
+	return c, nil
+}
+
+// runDigest posts the digest to defaultChannelID (if set) and every
+// subscribed channel, deduplicating in case a channel is both the default
+// and subscribed, and logging per-channel errors instead of aborting.
+func runDigest(ctx context.Context, defaultChannelID string) {
+	channels, err := subscribedChannels()
+	if err != nil {
+		logger.Error("loading digest subscriptions", "err", err)
+		return
+	}
+
+	seen := make(map[string]struct{}, len(channels)+1)
+	for _, channelID := range channels {
+		seen[channelID] = struct{}{}
+	}
+	if defaultChannelID != "" {
+		if _, ok := seen[defaultChannelID]; !ok {
+			channels = append(channels, defaultChannelID)
+		}
+	}
+
+	for _, channelID := range channels {
+		if err := postDigest(ctx, channelID); err != nil {
+			logger.Error("posting digest", "channel", channelID, "err", err)
+		}
+	}
+}
+
+// postDigest summarizes everything saved in the last 24h and posts a single
+// formatted message to channelID.
+func postDigest(ctx context.Context, channelID string) error {
+	links, err := recentHyperlinks(nowFunc().Add(-24 * time.Hour))
+	if err != nil {
+		return fmt.Errorf("loading recent hyperlinks: %w", err)
+	}
+	if len(links) == 0 {
+		slackSendMessage(channelID, "No links were saved in the last 24 hours.")
+		return nil
+	}
+
+	attachments := make([]slack.Attachment, 0, len(links))
+	for _, link := range links {
+		summary, err := summarizeArticle(ctx, link)
+		if err != nil {
+			summary = fmt.Sprintf("(could not summarize: %v)", err)
+		}
+		attachments = append(attachments, slack.Attachment{
+			Title:     link,
+			TitleLink: link,
+			Text:      summary,
+		})
+	}
+
+	_, _, err = slackClient.PostMessage(channelID,
+		slack.MsgOptionText("Daily digest:", false),
+		slack.MsgOptionAttachments(attachments...),
+	)
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupDigestTestDB(t *testing.T) {
+	t.Helper()
+	var err error
+	db, err = sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE hyperlinks (id INTEGER PRIMARY KEY AUTOINCREMENT, url TEXT UNIQUE, saved_ts INTEGER NOT NULL DEFAULT 0)`); err != nil {
+		t.Fatalf("creating hyperlinks table: %v", err)
+	}
+}
+
+func TestRecentHyperlinksUsesFakeClock(t *testing.T) {
+	setupDigestTestDB(t)
+
+	fakeNow := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	oldNowFunc := nowFunc
+	nowFunc = func() time.Time { return fakeNow }
+	t.Cleanup(func() { nowFunc = oldNowFunc })
+
+	insertAt := func(url string, ts time.Time) {
+		if _, err := db.Exec("INSERT INTO hyperlinks (url, saved_ts) VALUES (?, ?)", url, ts.Unix()); err != nil {
+			t.Fatalf("inserting hyperlink: %v", err)
+		}
+	}
+
+	insertAt("https://recent.example/a", fakeNow.Add(-1*time.Hour))
+	insertAt("https://recent.example/b", fakeNow.Add(-23*time.Hour))
+	insertAt("https://stale.example/c", fakeNow.Add(-25*time.Hour))
+
+	links, err := recentHyperlinks(nowFunc().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("recentHyperlinks: %v", err)
+	}
+
+	if len(links) != 2 {
+		t.Fatalf("expected 2 recent links, got %d: %v", len(links), links)
+	}
+	for _, want := range []string{"https://recent.example/a", "https://recent.example/b"} {
+		found := false
+		for _, got := range links {
+			if got == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected %s in recent links, got %v", want, links)
+		}
+	}
+}
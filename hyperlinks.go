@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// migrateHyperlinksSchema ensures the hyperlinks table matches the current
+// schema (url UNIQUE, title/description, saved_by/saved_channel/saved_ts,
+// tags, read_at), migrating in place from the older two-column
+// (id, url) schema and the (id, url, saved_at) schema that followed it.
+func migrateHyperlinksSchema(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS hyperlinks (id INTEGER PRIMARY KEY AUTOINCREMENT, url TEXT)`)
+	if err != nil {
+		return err
+	}
+
+	cols, err := hyperlinksColumns(db)
+	if err != nil {
+		return err
+	}
+	if cols["saved_by"] {
+		return nil // already on the current schema
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`CREATE TABLE hyperlinks_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL UNIQUE,
+		title TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		saved_by TEXT NOT NULL DEFAULT '',
+		saved_channel TEXT NOT NULL DEFAULT '',
+		saved_ts INTEGER NOT NULL DEFAULT 0,
+		tags TEXT NOT NULL DEFAULT '',
+		read_at TIMESTAMP NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	savedTsExpr := "0"
+	if cols["saved_at"] {
+		savedTsExpr = "saved_at"
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		`INSERT OR IGNORE INTO hyperlinks_new (url, saved_ts) SELECT url, %s FROM hyperlinks`,
+		savedTsExpr,
+	))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DROP TABLE hyperlinks`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`ALTER TABLE hyperlinks_new RENAME TO hyperlinks`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_hyperlinks_read_at ON hyperlinks(read_at)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_hyperlinks_tags ON hyperlinks(tags)`); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// hyperlinksColumns returns the set of column names currently on the
+// hyperlinks table.
+func hyperlinksColumns(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query(`PRAGMA table_info(hyperlinks)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var cid int
+		var name, colType string
+		var notNull, pk int
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols[name] = true
+	}
+	return cols, nil
+}
+
+// saveHyperlink saves url, fetching its page once to populate title and
+// description (og:title/og:description). Saving an already-known URL
+// updates its title/description/tags rather than erroring, since sharing a
+// link twice is common.
+func saveHyperlink(parentCtx context.Context, url, tags, savedBy, savedChannel string) error {
+	title, description := "", ""
+	ctx, cancel := context.WithTimeout(parentCtx, articleFetchTimeout)
+	defer cancel()
+	if _, body, err := fetchURL(ctx, url); err == nil {
+		title, description = extractOGMeta(string(body))
+	}
+
+	_, err := db.Exec(
+		`INSERT INTO hyperlinks (url, title, description, saved_by, saved_channel, saved_ts, tags)
+		 VALUES (?, ?, ?, ?, ?, strftime('%s','now'), ?)
+		 ON CONFLICT(url) DO UPDATE SET
+		   title = excluded.title,
+		   description = excluded.description,
+		   tags = excluded.tags`,
+		url, title, description, savedBy, savedChannel, tags,
+	)
+	return err
+}
+
+func listHyperlinks() ([]string, error) {
+	rows, err := db.Query("SELECT url FROM hyperlinks ORDER BY saved_ts DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		links = append(links, url)
+	}
+	return links, nil
+}
+
+// forgetHyperlink permanently deletes url.
+func forgetHyperlink(url string) error {
+	_, err := db.Exec("DELETE FROM hyperlinks WHERE url = ?", url)
+	return err
+}
+
+// randomHyperlinkFilter selects which pool of links !random draws from.
+type randomHyperlinkFilter struct {
+	unreadOnly bool
+	tag        string
+}
+
+// getRandomHyperlink picks a random link matching filter and marks it read
+// (read_at is set), without deleting the row.
+func getRandomHyperlink(filter randomHyperlinkFilter) (string, error) {
+	query := "SELECT id, url FROM hyperlinks WHERE 1=1"
+	var args []interface{}
+
+	if filter.unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	if filter.tag != "" {
+		query += " AND (',' || tags || ',') LIKE ?"
+		args = append(args, "%,"+filter.tag+",%")
+	}
+	query += " ORDER BY RANDOM() LIMIT 1"
+
+	var id int
+	var url string
+	if err := db.QueryRow(query, args...).Scan(&id, &url); err != nil {
+		return "", err
+	}
+
+	if _, err := db.Exec("UPDATE hyperlinks SET read_at = strftime('%s','now') WHERE id = ?", id); err != nil {
+		return "", err
+	}
+
+	return url, nil
+}
+
+var ogMetaRe = regexp.MustCompile(`(?is)<meta\s+[^>]*?(?:property|name)=["']og:(title|description)["'][^>]*?content=["']([^"']*)["'][^>]*>`)
+var ogMetaContentFirstRe = regexp.MustCompile(`(?is)<meta\s+[^>]*?content=["']([^"']*)["'][^>]*?(?:property|name)=["']og:(title|description)["'][^>]*>`)
+
+// extractOGMeta pulls og:title/og:description out of an HTML document,
+// tolerating either attribute order on the <meta> tag.
+func extractOGMeta(doc string) (title, description string) {
+	for _, match := range ogMetaRe.FindAllStringSubmatch(doc, -1) {
+		assignOGField(&title, &description, match[1], match[2])
+	}
+	for _, match := range ogMetaContentFirstRe.FindAllStringSubmatch(doc, -1) {
+		assignOGField(&title, &description, match[2], match[1])
+	}
+	return strings.TrimSpace(title), strings.TrimSpace(description)
+}
+
+func assignOGField(title, description *string, field, value string) {
+	switch field {
+	case "title":
+		if *title == "" {
+			*title = value
+		}
+	case "description":
+		if *description == "" {
+			*description = value
+		}
+	}
+}
+
+// parseRandomFilter interprets !random's trailing args: "unread" restricts
+// to unread links, "#tag" restricts to a tag, and anything else/empty means
+// no filter.
+func parseRandomFilter(args string) randomHyperlinkFilter {
+	switch {
+	case args == "unread":
+		return randomHyperlinkFilter{unreadOnly: true}
+	case strings.HasPrefix(args, "#") && len(args) > 1:
+		return randomHyperlinkFilter{tag: strings.ToLower(args[1:])}
+	default:
+		return randomHyperlinkFilter{}
+	}
+}
+
+// parseTags extracts "#tag" tokens from !save's trailing args and returns
+// them as a comma-joined string (e.g. "golang,ai"), plus the remaining text
+// with tags stripped (the URL).
+func parseTags(args string) (url, tags string) {
+	fields := strings.Fields(args)
+	var tagList []string
+	var rest []string
+	for _, f := range fields {
+		if strings.HasPrefix(f, "#") && len(f) > 1 {
+			tagList = append(tagList, strings.ToLower(f[1:]))
+		} else {
+			rest = append(rest, f)
+		}
+	}
+	return strings.Join(rest, " "), strings.Join(tagList, ",")
+}
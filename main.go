@@ -9,28 +9,39 @@ import (
 	//"io/ioutil"
 	"io"
 	"log"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/mmcdole/gofeed"
+	"github.com/robfig/cron/v3"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 )
 
 var (
-	slackClient     *slack.Client
-	socketClient    *socketmode.Client
-	db              *sql.DB
-	perplexityAPI   string
-	lastUserInput   string
-	lastBotResponse string
+	slackClient       *slack.Client
+	socketClient      *socketmode.Client
+	db                *sql.DB
+	perplexityAPI     string
+	router            *Router
+	conversationStore *ConversationStore
+	digestScheduler   *cron.Cron
+	digestChannelID   string
+	logger            = slog.New(slog.NewTextHandler(os.Stdout, nil))
 )
 
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize Slack client
 	slackToken := os.Getenv("SLACK_BOT_TOKEN")
 	appToken := os.Getenv("SLACK_APP_TOKEN")
@@ -47,19 +58,80 @@ func main() {
 	var err error
 	db, err = sql.Open("sqlite3", "./hyperlinks.db")
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("opening database", "err", err)
+		os.Exit(1)
+	}
+
+	// Create/migrate the hyperlinks table to the current schema.
+	if err := migrateHyperlinksSchema(db); err != nil {
+		logger.Error("migrating hyperlinks schema", "err", err)
+		os.Exit(1)
+	}
+
+	conversationStore, err = NewConversationStore(db)
+	if err != nil {
+		logger.Error("initializing conversation store", "err", err)
+		os.Exit(1)
+	}
+
+	// Create summaries table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS summaries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL UNIQUE,
+		summary TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		logger.Error("creating summaries table", "err", err)
+		os.Exit(1)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS subscriptions (
+		channel_id TEXT PRIMARY KEY,
+		subscribed_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		logger.Error("creating subscriptions table", "err", err)
+		os.Exit(1)
 	}
-	defer db.Close()
 
-	// Create hyperlinks table if not exists
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS hyperlinks (id INTEGER PRIMARY KEY AUTOINCREMENT, url TEXT)`)
+	router = buildRouter()
+
+	digestChannelID = os.Getenv("DIGEST_CHANNEL_ID")
+	digestScheduler, err = startDigestScheduler(ctx, digestChannelID, os.Getenv("DIGEST_CRON"))
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("starting digest scheduler", "err", err)
 	}
 
-	// Start listening to events
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		for evt := range socketClient.Events {
+		defer wg.Done()
+		eventLoop(ctx)
+	}()
+
+	runSocketModeWithReconnect(ctx)
+	wg.Wait()
+
+	if digestScheduler != nil {
+		<-digestScheduler.Stop().Done()
+	}
+	if err := db.Close(); err != nil {
+		logger.Error("closing database", "err", err)
+	}
+	logger.Info("shutdown complete")
+}
+
+// eventLoop consumes Socket Mode events until ctx is cancelled.
+func eventLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-socketClient.Events:
+			if !ok {
+				return
+			}
 			switch evt.Type {
 			case socketmode.EventTypeEventsAPI:
 				eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
@@ -67,88 +139,261 @@ func main() {
 					continue
 				}
 				socketClient.Ack(*evt.Request)
-				handleEventAPI(eventsAPIEvent)
+				handleEventAPI(ctx, eventsAPIEvent)
+			case socketmode.EventTypeInteractive:
+				callback, ok := evt.Data.(slack.InteractionCallback)
+				if !ok {
+					continue
+				}
+				socketClient.Ack(*evt.Request)
+				handleInteraction(ctx, callback)
 			}
 		}
-	}()
+	}
+}
 
-	err = socketClient.Run()
-	if err != nil {
-		log.Fatal(err)
+// runSocketModeWithReconnect runs the Socket Mode client, reconnecting with
+// exponential backoff and jitter on transient errors, until ctx is
+// cancelled.
+func runSocketModeWithReconnect(ctx context.Context) {
+	backoff := time.Second
+
+	for {
+		err := socketClient.RunContext(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("socket mode connection dropped, reconnecting", "err", err, "backoff", backoff)
+		}
+
+		jitter := time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff + jitter):
+		}
+
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
 	}
 }
 
-func handleEventAPI(event slackevents.EventsAPIEvent) {
+const maxReconnectBackoff = 30 * time.Second
+
+func handleEventAPI(ctx context.Context, event slackevents.EventsAPIEvent) {
 	switch ev := event.InnerEvent.Data.(type) {
 	case *slack.MessageEvent:
 		if ev.BotID == "" {
-			handleUserMessage(ev)
+			handleUserMessage(ctx, ev, event.TeamID)
 		}
 	}
 }
 
-func handleUserMessage(ev *slack.MessageEvent) {
-	text := strings.TrimSpace(ev.Text)
-	if strings.HasPrefix(text, "!save ") {
-		url := strings.TrimPrefix(text, "!save ")
-		err := saveHyperlink(url)
-		if err != nil {
-			slackSendMessage(ev.Channel, fmt.Sprintf("Error saving hyperlink: %v", err))
-		} else {
-			slackSendMessage(ev.Channel, "Hyperlink saved successfully!")
-		}
-	} else if text == "!list" {
-		links, err := listHyperlinks()
+func handleUserMessage(ctx context.Context, ev *slack.MessageEvent, team string) {
+	l := logger.With("team", team, "channel", ev.Channel, "user", ev.User)
+	if err := router.Dispatch(ctx, ev, team); err != nil {
+		l.Error("handling message", "err", err)
+		slackSendMessage(ev.Channel, fmt.Sprintf("Error: %v", err))
+	}
+}
+
+// buildRouter registers all `!`-commands and the Perplexity fallback.
+func buildRouter() *Router {
+	r := NewRouter()
+
+	r.Register(&Command{
+		Name: "!save",
+		Help: "!save <url> [#tag ...] - save a hyperlink, optionally tagged",
+		Handler: func(ctx CommandContext) error {
+			if ctx.Args == "" {
+				return fmt.Errorf("usage: !save <url> [#tag ...]")
+			}
+			url, tags := parseTags(ctx.Args)
+			if url == "" {
+				return fmt.Errorf("usage: !save <url> [#tag ...]")
+			}
+			if err := saveHyperlink(ctx.Ctx, url, tags, ctx.User, ctx.Channel); err != nil {
+				return fmt.Errorf("saving hyperlink: %w", err)
+			}
+			slackSendMessage(ctx.Channel, "Hyperlink saved successfully!")
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!forget",
+		Help: "!forget <url> - permanently delete a saved hyperlink",
+		Handler: func(ctx CommandContext) error {
+			if ctx.Args == "" {
+				return fmt.Errorf("usage: !forget <url>")
+			}
+			if err := forgetHyperlink(ctx.Args); err != nil {
+				return fmt.Errorf("forgetting hyperlink: %w", err)
+			}
+			slackSendMessage(ctx.Channel, fmt.Sprintf("Forgot %s", ctx.Args))
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!list",
+		Help: "!list - list saved hyperlinks with Summarize/Delete buttons",
+		Handler: func(ctx CommandContext) error {
+			links, err := listHyperlinks()
+			if err != nil {
+				return fmt.Errorf("listing hyperlinks: %w", err)
+			}
+			if len(links) == 0 {
+				slackSendMessage(ctx.Channel, "No hyperlinks saved yet.")
+				return nil
+			}
+			_, _, err = slackClient.PostMessage(ctx.Channel,
+				slack.MsgOptionText("Saved hyperlinks:", false),
+				slack.MsgOptionAttachments(linkListAttachments(links)...),
+			)
+			return err
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!random",
+		Help: "!random [unread|#tag] - get a random saved hyperlink (marks it read)",
+		Handler: func(ctx CommandContext) error {
+			link, err := getRandomHyperlink(parseRandomFilter(ctx.Args))
+			if err != nil {
+				return fmt.Errorf("getting random hyperlink: %w", err)
+			}
+			slackSendMessage(ctx.Channel, fmt.Sprintf("Random hyperlink: %s", link))
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!summarize",
+		Help: "!summarize - summarize a random saved hyperlink",
+		Handler: func(ctx CommandContext) error {
+			link, err := getRandomHyperlink(randomHyperlinkFilter{})
+			if err != nil {
+				return fmt.Errorf("getting random hyperlink: %w", err)
+			}
+			summary, err := summarizeArticle(ctx.Ctx, link)
+			if err != nil {
+				return fmt.Errorf("summarizing article: %w", err)
+			}
+			slackSendMessage(ctx.Channel, fmt.Sprintf("Summary of %s:\n%s", link, summary))
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!help",
+		Help: "!help - list available commands",
+		Handler: func(ctx CommandContext) error {
+			slackSendMessage(ctx.Channel, r.helpText())
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!digest",
+		Help: "!digest now - trigger the same digest job the daily scheduler runs",
+		Handler: func(ctx CommandContext) error {
+			if ctx.Args != "now" {
+				return fmt.Errorf("usage: !digest now")
+			}
+			runDigest(ctx.Ctx, digestChannelID)
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!subscribe",
+		Help: "!subscribe [#channel] - opt a channel (default: this one) into the daily digest",
+		Handler: func(ctx CommandContext) error {
+			channelID, err := resolveChannelArg(ctx.Args, ctx.Channel)
+			if err != nil {
+				return fmt.Errorf("resolving channel: %w", err)
+			}
+			if err := subscribeChannel(channelID); err != nil {
+				return fmt.Errorf("subscribing channel: %w", err)
+			}
+			slackSendMessage(ctx.Channel, fmt.Sprintf("<#%s> is now subscribed to the daily digest.", channelID))
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!unsubscribe",
+		Help: "!unsubscribe [#channel] - opt a channel (default: this one) out of the daily digest",
+		Handler: func(ctx CommandContext) error {
+			channelID, err := resolveChannelArg(ctx.Args, ctx.Channel)
+			if err != nil {
+				return fmt.Errorf("resolving channel: %w", err)
+			}
+			if err := unsubscribeChannel(channelID); err != nil {
+				return fmt.Errorf("unsubscribing channel: %w", err)
+			}
+			slackSendMessage(ctx.Channel, fmt.Sprintf("<#%s> is now unsubscribed from the daily digest.", channelID))
+			return nil
+		},
+	})
+
+	r.Register(&Command{
+		Name: "!reset",
+		Help: "!reset - clear the conversation history for this thread/channel",
+		Handler: func(ctx CommandContext) error {
+			if err := conversationStore.Reset(ctx.ConversationKey()); err != nil {
+				return fmt.Errorf("resetting conversation: %w", err)
+			}
+			slackSendMessage(ctx.Channel, "Conversation history cleared.")
+			return nil
+		},
+	})
+
+	r.SetFallback(func(ctx CommandContext) error {
+		key := ctx.ConversationKey()
+		history, err := conversationStore.History(key, maxHistoryTurns)
 		if err != nil {
-			slackSendMessage(ev.Channel, fmt.Sprintf("Error listing hyperlinks: %v", err))
-		} else {
-			slackSendMessage(ev.Channel, fmt.Sprintf("Saved hyperlinks:\n%s", strings.Join(links, "\n")))
+			return fmt.Errorf("loading conversation history: %w", err)
 		}
-	} else if text == "!random" {
-		link, err := getRandomHyperlink()
+		history = append(history, Message{Role: "user", Content: ctx.Args})
+
+		response, err := PerplexityAPI(ctx.Ctx, history)
 		if err != nil {
-			slackSendMessage(ev.Channel, fmt.Sprintf("Error getting random hyperlink: %v", err))
-		} else {
-			slackSendMessage(ev.Channel, fmt.Sprintf("Random hyperlink: %s", link))
+			return err
 		}
-	} else if text == "!summarize" {
-		link, err := getRandomHyperlink()
-		if err != nil {
-			slackSendMessage(ev.Channel, fmt.Sprintf("Error getting random hyperlink: %v", err))
-		} else {
-			summary, err := summarizeArticle(link)
-			if err != nil {
-				slackSendMessage(ev.Channel, fmt.Sprintf("Error summarizing article: %v", err))
-			} else {
-				slackSendMessage(ev.Channel, fmt.Sprintf("Summary of %s:\n%s", link, summary))
-			}
+
+		if err := conversationStore.Append(key, "user", ctx.Args); err != nil {
+			return fmt.Errorf("saving conversation turn: %w", err)
 		}
-	} else {
-		if text != lastUserInput {
-			lastUserInput = text
-			response, err := PerplexityAPI(text)
-			if err != nil {
-				slackSendMessage(ev.Channel, fmt.Sprintf("Error: %v", err))
-			} else {
-				lastBotResponse = response
-				slackSendMessage(ev.Channel, response)
-			}
-		} else {
-			slackSendMessage(ev.Channel, lastBotResponse)
+		if err := conversationStore.Append(key, "assistant", response); err != nil {
+			return fmt.Errorf("saving conversation turn: %w", err)
 		}
-	}
+
+		slackSendMessage(ctx.Channel, response)
+		return nil
+	})
+
+	return r
 }
 
-func PerplexityAPI(input string) (string, error) {
+// PerplexityAPI sends the full conversation history (oldest first) to
+// Perplexity's chat completions endpoint and returns the assistant's reply.
+// ctx is honored so the call aborts promptly on shutdown.
+func PerplexityAPI(ctx context.Context, history []Message) (string, error) {
 	url := "https://api.perplexity.ai/chat/completions"
+
+	messages := make([]map[string]string, len(history))
+	for i, m := range history {
+		messages[i] = map[string]string{"role": m.Role, "content": m.Content}
+	}
+
 	payload := map[string]interface{}{
-		"model": "gpt-3.5-turbo",
-		"messages": []map[string]string{
-			{
-				"role":    "user",
-				"content": input,
-			},
-		},
+		"model":    "gpt-3.5-turbo",
+		"messages": messages,
 	}
 
 	jsonPayload, err := json.Marshal(payload)
@@ -156,7 +401,7 @@ func PerplexityAPI(input string) (string, error) {
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonPayload)))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(string(jsonPayload)))
 	if err != nil {
 		return "", err
 	}
@@ -203,65 +448,7 @@ func PerplexityAPI(input string) (string, error) {
 func slackSendMessage(channelID, message string) {
 	_, _, err := slackClient.PostMessage(channelID, slack.MsgOptionText(message, false))
 	if err != nil {
-		log.Printf("Error sending message: %v", err)
-	}
-}
-
-func saveHyperlink(url string) error {
-	_, err := db.Exec("INSERT INTO hyperlinks (url) VALUES (?)", url)
-	return err
-}
-
-func listHyperlinks() ([]string, error) {
-	rows, err := db.Query("SELECT url FROM hyperlinks")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var links []string
-	for rows.Next() {
-		var url string
-		if err := rows.Scan(&url); err != nil {
-			return nil, err
-		}
-		links = append(links, url)
+		logger.Error("sending message", "channel", channelID, "err", err)
 	}
-	return links, nil
 }
 
-func getRandomHyperlink() (string, error) {
-	var url string
-	var id int
-	err := db.QueryRow("SELECT id, url FROM hyperlinks ORDER BY RANDOM() LIMIT 1").Scan(&id, &url)
-	if err != nil {
-		return "", err
-	}
-
-	_, err = db.Exec("DELETE FROM hyperlinks WHERE id = ?", id)
-	if err != nil {
-		return "", err
-	}
-
-	return url, nil
-}
-
-func summarizeArticle(url string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURLWithContext(url, ctx)
-	if err != nil {
-		return "", err
-	}
-
-	if len(feed.Items) == 0 {
-		return "", fmt.Errorf("no items found in the feed")
-	}
-
-	article := feed.Items[0]
-	summary := fmt.Sprintf("Title: %s\n\nDescription: %s", article.Title, article.Description)
-
-	return summary, nil
-}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// CommandContext carries the parsed invocation details for a single command.
+type CommandContext struct {
+	Ctx      context.Context
+	Team     string
+	Channel  string
+	User     string
+	ThreadTS string
+	Args     string
+	Event    *slack.MessageEvent
+}
+
+// ConversationKey returns the key this command's conversation history is
+// scoped under (see conversationKey).
+func (c CommandContext) ConversationKey() string {
+	return conversationKey(c.Team, c.Channel, c.ThreadTS, c.User)
+}
+
+// Command is a single slash-style `!name` command registered with a Router.
+type Command struct {
+	Name    string
+	Help    string
+	Handler func(ctx CommandContext) error
+}
+
+// Router dispatches `!command` text to registered Commands, falling back to
+// Perplexity for anything it doesn't recognize.
+type Router struct {
+	commands map[string]*Command
+	fallback func(ctx CommandContext) error
+}
+
+// NewRouter returns an empty Router. Use Register to add commands and
+// SetFallback to handle text that isn't a known command.
+func NewRouter() *Router {
+	return &Router{commands: make(map[string]*Command)}
+}
+
+// Register adds a command to the router, replacing any existing command
+// with the same name.
+func (r *Router) Register(cmd *Command) {
+	r.commands[cmd.Name] = cmd
+}
+
+// SetFallback sets the handler invoked when the input doesn't match any
+// registered command.
+func (r *Router) SetFallback(fn func(ctx CommandContext) error) {
+	r.fallback = fn
+}
+
+// Dispatch parses a raw Slack message and routes it to the matching command,
+// or the fallback handler if no `!name` prefix matches. parentCtx is
+// cancelled on shutdown so long-running handlers (Perplexity, article
+// fetches) abort promptly.
+func (r *Router) Dispatch(parentCtx context.Context, ev *slack.MessageEvent, team string) error {
+	text := strings.TrimSpace(ev.Text)
+	ctx := CommandContext{
+		Ctx:      parentCtx,
+		Team:     team,
+		Channel:  ev.Channel,
+		User:     ev.User,
+		ThreadTS: ev.ThreadTimestamp,
+		Event:    ev,
+	}
+
+	if strings.HasPrefix(text, "!") {
+		name, args := parseCommand(text)
+		if cmd, ok := r.commands[name]; ok {
+			ctx.Args = args
+			return cmd.Handler(ctx)
+		}
+	}
+
+	ctx.Args = text
+	if r.fallback != nil {
+		return r.fallback(ctx)
+	}
+	return nil
+}
+
+// parseCommand splits "!save https://foo #tag" into ("!save", "https://foo #tag").
+func parseCommand(text string) (name, args string) {
+	fields := strings.SplitN(text, " ", 2)
+	name = fields[0]
+	if len(fields) > 1 {
+		args = strings.TrimSpace(fields[1])
+	}
+	return name, args
+}
+
+// helpText auto-generates a `!help` listing from the registered commands,
+// sorted alphabetically so output is stable.
+func (r *Router) helpText() string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Available commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s\n", r.commands[name].Help)
+	}
+	return b.String()
+}
+
+// handleInteraction processes Slack Interactivity payloads (button/select
+// actions attached to messages we sent, e.g. the "Summarize"/"Delete"
+// buttons on `!list` entries). ctx is cancelled on shutdown.
+func handleInteraction(ctx context.Context, callback slack.InteractionCallback) {
+	if len(callback.ActionCallback.AttachmentActions) == 0 {
+		return
+	}
+
+	action := callback.ActionCallback.AttachmentActions[0]
+	switch action.Name {
+	case "summarize":
+		url := action.Value
+		summary, err := summarizeArticle(ctx, url)
+		if err != nil {
+			slackSendMessage(callback.Channel.ID, fmt.Sprintf("Error summarizing article: %v", err))
+			return
+		}
+		slackSendMessage(callback.Channel.ID, fmt.Sprintf("Summary of %s:\n%s", url, summary))
+	case "delete":
+		if err := forgetHyperlink(action.Value); err != nil {
+			slackSendMessage(callback.Channel.ID, fmt.Sprintf("Error deleting hyperlink: %v", err))
+			return
+		}
+		slackSendMessage(callback.Channel.ID, fmt.Sprintf("Removed %s", action.Value))
+	}
+}
+
+// linkListAttachments renders one slack.Attachment per saved link, each with
+// "Summarize" and "Delete" buttons, for use in response to `!list`.
+func linkListAttachments(links []string) []slack.Attachment {
+	attachments := make([]slack.Attachment, 0, len(links))
+	for i, link := range links {
+		attachments = append(attachments, slack.Attachment{
+			Text:       link,
+			CallbackID: fmt.Sprintf("list_action_%d", i),
+			Actions: []slack.AttachmentAction{
+				{
+					Name:  "summarize",
+					Text:  "Summarize",
+					Type:  "button",
+					Value: link,
+				},
+				{
+					Name:  "delete",
+					Text:  "Delete",
+					Type:  "button",
+					Style: "danger",
+					Value: link,
+				},
+			},
+		})
+	}
+	return attachments
+}